@@ -0,0 +1,146 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const serverSoftware = "gemini-go"
+
+// DefaultCGITimeout bounds how long a program started by CGIHandler may
+// run before it is killed. CGIHandler has no option to set another timeout.
+const DefaultCGITimeout = 30 * time.Second
+
+// cgiHandler serves dynamic content by executing programs found under
+// Root, in the style of the CGI/1.1 conventions adapted to Gemini. Use
+// CGIHandler to construct one.
+type cgiHandler struct {
+	Root    string
+	Timeout time.Duration
+}
+
+// CGIHandler returns a Handler that, for a request mapping to an
+// executable regular file under root, spawns it with the Gemini CGI
+// environment and streams its stdout verbatim to the client. The program
+// is expected to emit its own "status meta\r\n" response header.
+func CGIHandler(root string) Handler {
+	return &cgiHandler{Root: root}
+}
+
+func (h *cgiHandler) ServeGemini(w *ResponseWriter, r *Request) {
+	script, scriptName, pathInfo, ok := h.lookup(r.URL.Path)
+	if !ok {
+		w.WriteHeader(NotFound())
+		return
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultCGITimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, script)
+	cmd.Dir = filepath.Dir(script)
+	cmd.Env = cgiEnviron(r, scriptName, pathInfo)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		w.WriteHeader(CGIError())
+		return
+	}
+
+	if err := cmd.Start(); err != nil {
+		w.WriteHeader(CGIError())
+		return
+	}
+
+	// The script emits its own response header, so its output is copied
+	// straight to the connection instead of going through
+	// ResponseWriter's default-header logic.
+	n, copyErr := io.Copy(w.conn, stdout)
+	waitErr := cmd.Wait()
+
+	if n == 0 && (copyErr != nil || waitErr != nil) {
+		// Nothing reached the client yet, so a proper status line can
+		// still be sent.
+		w.WriteHeader(CGIError())
+		return
+	}
+
+	// Either this ran cleanly, or it failed after the script had already
+	// written its own header and possibly body; either way, the header
+	// has been sent and Finish must not append another one.
+	w.markSent()
+}
+
+// lookup finds the longest path prefix under Root that names an
+// executable regular file, treating the remainder as PATH_INFO.
+func (h *cgiHandler) lookup(urlPath string) (script, scriptName, pathInfo string, ok bool) {
+	clean := path.Clean("/" + urlPath)
+	segments := strings.Split(strings.TrimPrefix(clean, "/"), "/")
+
+	for i := len(segments); i >= 1; i-- {
+		rel := path.Join(segments[:i]...)
+		candidate := filepath.Join(h.Root, filepath.FromSlash(rel))
+
+		info, err := os.Stat(candidate)
+		if err != nil || info.IsDir() || info.Mode()&0o111 == 0 {
+			continue
+		}
+
+		return candidate, "/" + rel, "/" + path.Join(segments[i:]...), true
+	}
+
+	return "", "", "", false
+}
+
+func cgiEnviron(r *Request, scriptName, pathInfo string) []string {
+	if pathInfo == "/" {
+		pathInfo = ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr.String())
+	if err != nil {
+		host = r.RemoteAddr.String()
+	}
+
+	env := []string{
+		"PATH=" + os.Getenv("PATH"),
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_PROTOCOL=GEMINI",
+		"SERVER_SOFTWARE=" + serverSoftware,
+		"GEMINI_URL=" + r.URL.String(),
+		"SCRIPT_NAME=" + scriptName,
+		"PATH_INFO=" + pathInfo,
+		"QUERY_STRING=" + r.URL.RawQuery,
+		"REMOTE_ADDR=" + host,
+		"REMOTE_HOST=" + host,
+	}
+
+	if cert := r.ClientCertificate(); cert != nil {
+		env = append(env,
+			"AUTH_TYPE=Certificate",
+			"REMOTE_USER="+cert.Subject.CommonName,
+			"TLS_CLIENT_HASH="+r.ClientCertificateHash(),
+			"TLS_CLIENT_ISSUER="+cert.Issuer.String(),
+			"TLS_CLIENT_SUBJECT="+cert.Subject.String(),
+			"TLS_CLIENT_NOT_AFTER="+cert.NotAfter.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return env
+}
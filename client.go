@@ -50,11 +50,46 @@ func (c *ClientConn) SetReadDeadline(t time.Time) error {
 	return c.conn.SetReadDeadline(t)
 }
 
+// DefaultMaxRedirects is a reasonable value for Dialer.FollowRedirects.
+const DefaultMaxRedirects = 5
+
+// DefaultMaxSlowDown is used by Dial when Dialer.HonorSlowDown is set and
+// Dialer.MaxSlowDown is zero.
+const DefaultMaxSlowDown = 2 * time.Minute
+
+// RedirectLoopError is returned by Dialer.Dial when a redirect chain
+// revisits a URL it has already seen.
+type RedirectLoopError struct {
+	URL string
+}
+
+func (e *RedirectLoopError) Error() string {
+	return fmt.Sprintf("gemini: redirect loop at %s", e.URL)
+}
+
 type Dialer struct {
 	tls.Dialer
 	Net            string
 	Addr           string
 	ReadBufferSize int
+
+	// KnownHosts, if set, enables Trust-On-First-Use certificate
+	// verification instead of requiring Config.InsecureSkipVerify to be
+	// set by the caller.
+	KnownHosts *KnownHosts
+
+	// FollowRedirects bounds how many redirects Dial follows
+	// automatically, enforcing the Gemini spec's same-scheme
+	// requirement and refusing to revisit a URL (returning a
+	// *RedirectLoopError). Zero disables following; DefaultMaxRedirects
+	// is a reasonable bound.
+	FollowRedirects int
+
+	// HonorSlowDown makes Dial transparently retry a StatusSlowDown
+	// response after sleeping for the duration it names, until
+	// MaxSlowDown (or DefaultMaxSlowDown, if zero) is exhausted.
+	HonorSlowDown bool
+	MaxSlowDown   time.Duration
 }
 
 func Dial(ctx context.Context, url string, c *tls.Config) (*ClientConn, ResponseHeader, error) {
@@ -72,7 +107,89 @@ func Dial(ctx context.Context, url string, c *tls.Config) (*ClientConn, Response
 	return d.Dial(ctx, u)
 }
 
+// Dial connects to u and reads its response header, transparently
+// following redirects and retrying after StatusSlowDown as configured by
+// FollowRedirects and HonorSlowDown.
 func (d *Dialer) Dial(ctx context.Context, u *url.URL) (*ClientConn, ResponseHeader, error) {
+	remainingWait := d.MaxSlowDown
+	if remainingWait == 0 {
+		remainingWait = DefaultMaxSlowDown
+	}
+	visited := make(map[string]bool)
+	reqURL := u
+
+	for {
+		conn, header, err := d.dialOnce(ctx, reqURL)
+		if err != nil {
+			return nil, header, err
+		}
+
+		if header.Status == StatusSlowDown && d.HonorSlowDown {
+			wait, werr := parseSlowDownWait(header.Meta)
+			if werr != nil {
+				conn.Close()
+				return nil, header, werr
+			}
+			if wait > remainingWait {
+				conn.Close()
+				return nil, header, fmt.Errorf("gemini: %s kept responding slow down; retry budget exhausted", reqURL.Hostname())
+			}
+			remainingWait -= wait
+			conn.Close()
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, header, ctx.Err()
+			case <-timer.C:
+			}
+			continue
+		}
+
+		if header.Redirect() && d.FollowRedirects > 0 {
+			if len(visited) >= d.FollowRedirects {
+				conn.Close()
+				return nil, header, fmt.Errorf("gemini: exceeded %d redirects", d.FollowRedirects)
+			}
+			if visited[reqURL.String()] {
+				conn.Close()
+				return nil, header, &RedirectLoopError{URL: reqURL.String()}
+			}
+			visited[reqURL.String()] = true
+
+			next, perr := url.Parse(header.Meta)
+			if perr != nil {
+				conn.Close()
+				return nil, header, fmt.Errorf("gemini: invalid redirect target: %w", perr)
+			}
+			next = reqURL.ResolveReference(next)
+			if next.Scheme != reqURL.Scheme {
+				conn.Close()
+				return nil, header, fmt.Errorf("gemini: refusing to redirect from %q to %q", reqURL.Scheme, next.Scheme)
+			}
+			conn.Close()
+			reqURL = next
+			continue
+		}
+
+		return conn, header, nil
+	}
+}
+
+// parseSlowDownWait parses a StatusSlowDown response's Meta field, the
+// integer count of seconds to wait before retrying.
+func parseSlowDownWait(meta string) (time.Duration, error) {
+	n, err := strconv.ParseUint(meta, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("gemini: malformed slow down duration: %w", err)
+	}
+	return time.Duration(n) * time.Second, nil
+}
+
+// dialOnce performs a single request/response round trip, without
+// following redirects or retrying on StatusSlowDown.
+func (d *Dialer) dialOnce(ctx context.Context, u *url.URL) (*ClientConn, ResponseHeader, error) {
 	if u.Scheme != "gemini" {
 		return nil, ResponseHeader{}, fmt.Errorf("unsupported protocol: %q", u.Scheme)
 	}
@@ -98,6 +215,11 @@ func (d *Dialer) Dial(ctx context.Context, u *url.URL) (*ClientConn, ResponseHea
 	tlsDialer := d.Dialer
 	tlsDialer.Config = initTLSConfig(tlsDialer.Config)
 
+	if d.KnownHosts != nil {
+		tlsDialer.Config.InsecureSkipVerify = true
+		tlsDialer.Config.VerifyPeerCertificate = d.KnownHosts.VerifyPeerCertificate(addr)
+	}
+
 	var ok bool
 
 	x, err := tlsDialer.DialContext(ctx, network, addr)
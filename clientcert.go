@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// ClientCertificate returns the client's leaf certificate, or nil if none
+// was presented. Presenting it requires the server's TLS config to have
+// ClientAuth set to request one, which RequireClientCert arranges
+// automatically when registered with a ServeMux or Server.
+func (r *Request) ClientCertificate() *x509.Certificate {
+	if len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
+
+// ClientCertificateHash returns the lowercase hex SHA-256 hash of the
+// client certificate's DER encoding, matching the CGI TLS_CLIENT_HASH
+// variable, or "" if no certificate was presented.
+func (r *Request) ClientCertificateHash() string {
+	cert := r.ClientCertificate()
+	if cert == nil {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("%x", sum)
+}
+
+// Authorizer decides whether a client certificate, identified by the
+// fingerprint returned by Request.ClientCertificateHash, may proceed.
+type Authorizer func(fingerprint string) bool
+
+// RequireClientCert wraps h so that it is only reached when the client has
+// presented a currently-valid certificate. Requests are rejected with
+// StatusClientCertificateRequired when no certificate is presented,
+// StatusCertificateNotValid when it's expired or not yet valid, and
+// StatusCertificateNotAuthorized when authorize rejects its fingerprint
+// (authorize may be nil to accept any valid certificate).
+//
+// Registering the returned Handler with a ServeMux or Server causes
+// ClientAuth to be set to tls.RequestClientCert automatically.
+func RequireClientCert(h Handler, authorize Authorizer) Handler {
+	return &requireClientCertHandler{h, authorize}
+}
+
+type requireClientCertHandler struct {
+	next      Handler
+	authorize Authorizer
+}
+
+func (h *requireClientCertHandler) ServeGemini(w *ResponseWriter, r *Request) {
+	cert := r.ClientCertificate()
+	if cert == nil {
+		w.WriteHeader(ClientCertificateRequired())
+		return
+	}
+
+	now := time.Now()
+	if now.After(cert.NotAfter) || now.Before(cert.NotBefore) {
+		w.WriteHeader(CertificateNotValid())
+		return
+	}
+
+	if h.authorize != nil && !h.authorize(r.ClientCertificateHash()) {
+		w.WriteHeader(CertificateNotAuthorized())
+		return
+	}
+
+	h.next.ServeGemini(w, r)
+}
+
+// RequiresClientCert marks h (or a Handler wrapping it, such as a
+// ServeMux) as needing client certificates requested during the TLS
+// handshake. Server.Serve consults it via a type assertion.
+func (h *requireClientCertHandler) RequiresClientCert() bool {
+	return true
+}
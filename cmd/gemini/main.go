@@ -10,15 +10,20 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 
 	"github.com/tsavola/gemini"
 )
 
-var tlsConfig = &tls.Config{
-	InsecureSkipVerify: true,
+var dialer = gemini.Dialer{
+	Dialer: tls.Dialer{
+		Config: &tls.Config{},
+	},
+	FollowRedirects: gemini.DefaultMaxRedirects,
+	HonorSlowDown:   true,
 }
 
 var isTerm *bool
@@ -33,31 +38,35 @@ func main() {
 		os.Exit(2)
 	}
 
+	if err := initKnownHosts(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
 	url := flag.Arg(0)
 	if !strings.Contains(url, "://") {
 		url = "gemini://" + url
 	}
 
-	for {
-		header, err := do(url)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "error:", err)
-		}
-
-		if !header.Redirect() {
-			code := 1
-			if err == nil && header.Success() {
-				code = 0
-			}
-			os.Exit(code)
-		}
+	header, err := do(url)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+	}
 
-		url = header.Meta
+	code := 1
+	if err == nil && header.Success() {
+		code = 0
 	}
+	os.Exit(code)
 }
 
-func do(url string) (gemini.ResponseHeader, error) {
-	conn, header, err := gemini.Dial(context.Background(), url, tlsConfig)
+func do(rawURL string) (gemini.ResponseHeader, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return gemini.ResponseHeader{}, err
+	}
+
+	conn, header, err := dialer.Dial(context.Background(), u)
 	if err != nil {
 		return header, err
 	}
@@ -67,23 +76,11 @@ func do(url string) (gemini.ResponseHeader, error) {
 		}
 	}()
 
-	if !(header.Success() || header.Redirect()) {
+	if !header.Success() {
 		s := header.Meta
 		if s == "" {
 			s = header.Status.String()
 		}
-
-		switch {
-		case header.Status == gemini.StatusSlowDown:
-			if n, err := strconv.ParseUint(header.Meta, 10, 64); err == nil {
-				if n == 1 {
-					s = fmt.Sprintf("%s (1 second)", s)
-				} else {
-					s = fmt.Sprintf("%s (%d seconds)", s, n)
-				}
-			}
-		}
-
 		fmt.Fprintln(os.Stderr, "status:", s)
 	}
 
@@ -95,3 +92,28 @@ func do(url string) (gemini.ResponseHeader, error) {
 	conn = nil
 	return header, err
 }
+
+// initKnownHosts loads the known-hosts file used for Trust-On-First-Use
+// certificate verification, creating its parent directory if necessary,
+// and wires it into dialer so InsecureSkipVerify is never needed. Confirm
+// is left nil: new and renewed certificates are trusted automatically, as
+// is customary for a non-interactive client, while a genuine mismatch is
+// still denied.
+func initKnownHosts() error {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return err
+	}
+	dir = filepath.Join(dir, "gemini")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	known, err := gemini.LoadKnownHosts(filepath.Join(dir, "known_hosts"))
+	if err != nil {
+		return err
+	}
+
+	dialer.KnownHosts = known
+	return nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+var indexFiles = []string{"index.gmi", "index.gemini"}
+
+// FileHandler serves files out of a file system, the way net/http's
+// fileHandler serves http.FileSystem trees. Use FileServer to construct
+// one with sane defaults.
+type FileHandler struct {
+	FileSystem http.FileSystem
+
+	// Tombstone, if non-empty, names a marker file whose presence in a
+	// directory causes requests for that directory to be answered with
+	// StatusGone instead of its index file or listing. Files inside the
+	// directory, including the index file, are still served when requested
+	// by name.
+	Tombstone string
+}
+
+// FileServer returns a Handler that serves files from fs, modeled after
+// net/http.FileServer: directories are served via an index.gmi/index.gemini
+// file if present, otherwise as a generated text/gemini directory listing.
+func FileServer(fs http.FileSystem) Handler {
+	return &FileHandler{FileSystem: fs, Tombstone: ".gone"}
+}
+
+func (h *FileHandler) ServeGemini(w *ResponseWriter, r *Request) {
+	name := path.Clean(r.URL.Path)
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	if h.gone(name) {
+		w.WriteHeader(Gone())
+		return
+	}
+
+	f, err := h.FileSystem.Open(name)
+	if err != nil {
+		w.WriteHeader(statusForOpenError(err))
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		w.WriteHeader(TemporaryFailure(err.Error()))
+		return
+	}
+
+	if info.IsDir() {
+		h.serveDir(w, name, f)
+		return
+	}
+
+	h.serveFile(w, name, f)
+}
+
+func (h *FileHandler) gone(name string) bool {
+	if h.Tombstone == "" {
+		return false
+	}
+
+	f, err := h.FileSystem.Open(path.Join(name, h.Tombstone))
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+func (h *FileHandler) serveDir(w *ResponseWriter, name string, dir http.File) {
+	for _, index := range indexFiles {
+		f, err := h.FileSystem.Open(path.Join(name, index))
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			continue
+		}
+		if info.IsDir() {
+			f.Close()
+			continue
+		}
+		h.serveFile(w, path.Join(name, index), f)
+		return
+	}
+
+	h.serveListing(w, name, dir)
+}
+
+func (h *FileHandler) serveListing(w *ResponseWriter, name string, dir http.File) {
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		w.WriteHeader(TemporaryFailure(err.Error()))
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	w.WriteHeader(Success("text/gemini; charset=utf-8"))
+	fmt.Fprintf(w, "# Index of %s\n\n", name)
+	if name != "/" {
+		fmt.Fprintf(w, "=> %s ..\n", path.Join(name, ".."))
+	}
+	for _, e := range entries {
+		label := e.Name()
+		href := path.Join(name, url.PathEscape(label))
+		if e.IsDir() {
+			label += "/"
+			href += "/"
+		}
+		fmt.Fprintf(w, "=> %s %s\n", href, label)
+	}
+}
+
+func (h *FileHandler) serveFile(w *ResponseWriter, name string, f http.File) {
+	w.WriteHeader(Success(contentType(name, f)))
+	io.Copy(w, f)
+}
+
+func contentType(name string, f http.File) string {
+	switch {
+	case strings.HasSuffix(name, ".gmi"), strings.HasSuffix(name, ".gemini"):
+		return "text/gemini; charset=utf-8"
+	}
+
+	var buf [512]byte
+	n, _ := io.ReadFull(f, buf[:])
+	f.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+func statusForOpenError(err error) ResponseHeader {
+	if os.IsNotExist(err) {
+		return NotFound()
+	}
+	return TemporaryFailure(err.Error())
+}
@@ -0,0 +1,19 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+// Handler responds to a Gemini request. ServeGemini should write a header
+// via ResponseWriter.WriteHeader (or let the first Write default it to
+// Success("text/gemini")) and then the response body, if any.
+type Handler interface {
+	ServeGemini(w *ResponseWriter, r *Request)
+}
+
+// HandlerFunc adapts an ordinary function to a Handler.
+type HandlerFunc func(w *ResponseWriter, r *Request)
+
+func (f HandlerFunc) ServeGemini(w *ResponseWriter, r *Request) {
+	f(w, r)
+}
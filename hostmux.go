@@ -0,0 +1,110 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+// HostMux multiplexes a single listener across several virtual hosts,
+// dispatching on the SNI hostname seen during the TLS handshake. Each host
+// presents its own certificate, via tls.Config.GetConfigForClient.
+type HostMux struct {
+	// Default handles requests for hosts with no registered entry. If
+	// nil, such requests get StatusNotFound.
+	Default Handler
+
+	// DefaultTLSConfig completes the TLS handshake for connections whose
+	// SNI hostname (or lack of one) doesn't match a registered host; it
+	// must carry a certificate (via Certificates or GetCertificate), or
+	// such handshakes fail before Default is ever reached. It is cloned
+	// and given the module's default cipher suites and minimum version
+	// where unset, as Listen/Server do.
+	DefaultTLSConfig *tls.Config
+
+	mu    sync.RWMutex
+	hosts map[string]*hostEntry
+}
+
+type hostEntry struct {
+	handler Handler
+	config  *tls.Config
+}
+
+// NewHostMux allocates and returns a new HostMux.
+func NewHostMux() *HostMux {
+	return &HostMux{hosts: make(map[string]*hostEntry)}
+}
+
+// Handle registers handler and config for host. config is used to
+// complete the TLS handshake for connections whose SNI hostname is host;
+// it is cloned and given the module's default cipher suites and minimum
+// version where unset, as Listen/Server do.
+func (m *HostMux) Handle(host string, handler Handler, config *tls.Config) {
+	config = initTLSConfig(config)
+	if rc, ok := handler.(interface{ RequiresClientCert() bool }); ok && rc.RequiresClientCert() {
+		config.ClientAuth = tls.RequestClientCert
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hosts[host] = &hostEntry{handler, config}
+}
+
+func (m *HostMux) lookup(host string) *hostEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.hosts[host]
+}
+
+// GetConfigForClient is a tls.Config.GetConfigForClient callback that
+// selects the registered TLS config for the ClientHello's SNI hostname. It
+// returns (nil, nil) for an unregistered host, so the listener's base
+// config is used instead.
+func (m *HostMux) GetConfigForClient(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	e := m.lookup(hello.ServerName)
+	if e == nil {
+		return nil, nil
+	}
+	return e.config.Clone(), nil
+}
+
+// TLSConfig returns a tls.Config, based on DefaultTLSConfig, with
+// GetConfigForClient wired to m, suitable for use as Server.TLSConfig. It
+// is what completes the handshake when GetConfigForClient defers to the
+// base config, i.e. for hosts with no registered entry.
+func (m *HostMux) TLSConfig() *tls.Config {
+	config := initTLSConfig(m.DefaultTLSConfig)
+	config.GetConfigForClient = m.GetConfigForClient
+
+	if rc, ok := m.Default.(interface{ RequiresClientCert() bool }); ok && rc.RequiresClientCert() {
+		config.ClientAuth = tls.RequestClientCert
+	}
+
+	return config
+}
+
+// ServeGemini dispatches to the Handler registered for the request's host,
+// preferring the SNI hostname seen during the handshake over the request
+// URL's host.
+func (m *HostMux) ServeGemini(w *ResponseWriter, r *Request) {
+	host := r.ServerName
+	if host == "" {
+		host = r.URL.Hostname()
+	}
+
+	if e := m.lookup(host); e != nil {
+		e.handler.ServeGemini(w, r)
+		return
+	}
+
+	if m.Default != nil {
+		m.Default.ServeGemini(w, r)
+		return
+	}
+
+	w.WriteHeader(NotFound())
+}
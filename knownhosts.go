@@ -0,0 +1,261 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCertificateMismatch is returned by KnownHosts.Verify when the peer
+// presents a certificate whose fingerprint doesn't match the one on file,
+// and the stored entry hasn't expired.
+var ErrCertificateMismatch = errors.New("gemini: certificate fingerprint mismatch")
+
+// HostEntry is a single line of a KnownHosts file: a host[:port], the
+// SHA-256 fingerprint of its certificate, and the certificate's expiry.
+type HostEntry struct {
+	Host        string
+	Fingerprint string // Hex-encoded SHA-256 of the leaf certificate's DER encoding.
+	NotAfter    time.Time
+}
+
+func (e HostEntry) String() string {
+	return fmt.Sprintf("%s sha256:%s %s", e.Host, e.Fingerprint, e.NotAfter.UTC().Format(time.RFC3339))
+}
+
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("%x", sum)
+}
+
+// KnownHosts implements Trust-On-First-Use certificate verification, as
+// used by most Gemini clients in lieu of a CA PKI: the first certificate
+// seen for a host is remembered, and subsequent connections must present
+// the same certificate (or a renewed one, once the stored entry expires).
+//
+// A KnownHosts is safe for concurrent use.
+type KnownHosts struct {
+	// Confirm is consulted whenever a host is seen for the first time,
+	// when its stored certificate has expired and is about to be
+	// replaced, or when it presents a certificate that doesn't match a
+	// still-valid stored entry. For the first two cases, a nil Confirm
+	// accepts the change automatically; for a mismatch, a nil Confirm
+	// rejects it. Returning false always rejects the connection.
+	Confirm func(host string, cert *x509.Certificate, prior *HostEntry) bool
+
+	path    string
+	mu      sync.Mutex
+	entries map[string]HostEntry
+}
+
+// LoadKnownHosts reads a known-hosts file in the common
+// "host[:port] sha256:fingerprint notAfter" format used by Gemini clients.
+// A missing file is not an error; it is treated as empty.
+func LoadKnownHosts(path string) (*KnownHosts, error) {
+	k := &KnownHosts{
+		path:    path,
+		entries: make(map[string]HostEntry),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("gemini: malformed known-hosts line: %q", line)
+		}
+
+		notAfter, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("gemini: malformed known-hosts line: %w", err)
+		}
+
+		k.entries[fields[0]] = HostEntry{
+			Host:        fields[0],
+			Fingerprint: strings.TrimPrefix(fields[1], "sha256:"),
+			NotAfter:    notAfter,
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Lookup returns the stored entry for host, if any.
+func (k *KnownHosts) Lookup(host string) (entry HostEntry, found bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entry, found = k.entries[host]
+	return
+}
+
+// Trust unconditionally records cert as the trusted certificate for host,
+// replacing any prior entry, and persists the file.
+func (k *KnownHosts) Trust(host string, cert *x509.Certificate) error {
+	k.mu.Lock()
+	k.entries[host] = HostEntry{
+		Host:        host,
+		Fingerprint: fingerprint(cert),
+		NotAfter:    cert.NotAfter,
+	}
+	k.mu.Unlock()
+
+	return k.save()
+}
+
+// Verify checks cert against the stored entry for host. An unseen host is
+// trusted on first use. A host whose stored certificate has expired is
+// re-trusted with the new certificate. Any other mismatch is rejected with
+// ErrCertificateMismatch, unless Confirm approves the new certificate
+// despite the mismatch. Confirm, if set, is asked to approve all three
+// kinds of trust decisions before they take effect.
+func (k *KnownHosts) Verify(host string, cert *x509.Certificate) error {
+	print := fingerprint(cert)
+
+	k.mu.Lock()
+	prior, found := k.entries[host]
+	k.mu.Unlock()
+
+	switch {
+	case !found:
+		if k.Confirm != nil && !k.Confirm(host, cert, nil) {
+			return fmt.Errorf("gemini: certificate for %s not confirmed", host)
+		}
+		return k.Trust(host, cert)
+
+	case prior.Fingerprint == print:
+		return nil
+
+	case time.Now().After(prior.NotAfter):
+		if k.Confirm != nil && !k.Confirm(host, cert, &prior) {
+			return fmt.Errorf("gemini: renewed certificate for %s not confirmed", host)
+		}
+		return k.Trust(host, cert)
+
+	default:
+		if k.Confirm != nil && k.Confirm(host, cert, &prior) {
+			return k.Trust(host, cert)
+		}
+		return fmt.Errorf("%w: %s", ErrCertificateMismatch, host)
+	}
+}
+
+// VerifyPeerCertificate returns a tls.Config.VerifyPeerCertificate-style
+// callback bound to host, suitable for Dialer.Config or a direct
+// tls.Config passed to Dial. The connection should be established with
+// InsecureSkipVerify so the default CA verification doesn't run first.
+func (k *KnownHosts) VerifyPeerCertificate(host string) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("gemini: no certificate presented")
+		}
+
+		cert, err := x509.ParseCertificate(rawCerts[0])
+		if err != nil {
+			return err
+		}
+
+		return k.Verify(host, cert)
+	}
+}
+
+// save persists the known-hosts file, taking a lock file alongside it so
+// that concurrent writers (e.g. multiple client processes sharing a
+// known_hosts file) don't clobber each other. While holding the lock, it
+// reloads whatever is currently on disk and merges it with the in-memory
+// entries, so a host trusted by another process in the meantime isn't
+// lost to a stale overwrite.
+func (k *KnownHosts) save() error {
+	if k.path == "" {
+		return nil
+	}
+
+	unlock, err := lockFile(k.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	onDisk, err := LoadKnownHosts(k.path)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for host, entry := range onDisk.entries {
+		if _, found := k.entries[host]; !found {
+			k.entries[host] = entry
+		}
+	}
+
+	tmp := k.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range k.entries {
+		if _, err := fmt.Fprintln(f, e.String()); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, k.path)
+}
+
+// lockFile takes a simple advisory lock by exclusively creating path,
+// retrying every 50 milliseconds until it succeeds or five seconds pass. The
+// returned function releases the lock.
+func lockFile(path string) (unlock func(), err error) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("gemini: timed out waiting for lock on %s", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustSelfSigned(t *testing.T, notAfter time.Time) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestKnownHostsVerifyTrustOnFirstUse(t *testing.T) {
+	k, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := mustSelfSigned(t, time.Now().Add(time.Hour))
+
+	if err := k.Verify("example.org:1965", cert); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, found := k.Lookup("example.org:1965"); !found {
+		t.Fatal("first use did not record an entry")
+	}
+
+	// The same certificate on a later connection must still verify.
+	if err := k.Verify("example.org:1965", cert); err != nil {
+		t.Fatalf("repeat use: %v", err)
+	}
+}
+
+func TestKnownHostsVerifyMismatch(t *testing.T) {
+	k, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := mustSelfSigned(t, time.Now().Add(time.Hour))
+	second := mustSelfSigned(t, time.Now().Add(time.Hour))
+
+	if err := k.Verify("example.org:1965", first); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	err = k.Verify("example.org:1965", second)
+	if !errors.Is(err, ErrCertificateMismatch) {
+		t.Fatalf("mismatch: got %v, want ErrCertificateMismatch", err)
+	}
+}
+
+func TestKnownHostsVerifyMismatchConfirmed(t *testing.T) {
+	k, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := mustSelfSigned(t, time.Now().Add(time.Hour))
+	second := mustSelfSigned(t, time.Now().Add(time.Hour))
+
+	if err := k.Verify("example.org:1965", first); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	var sawPrior *HostEntry
+	k.Confirm = func(host string, cert *x509.Certificate, prior *HostEntry) bool {
+		sawPrior = prior
+		return true
+	}
+
+	if err := k.Verify("example.org:1965", second); err != nil {
+		t.Fatalf("confirmed mismatch: %v", err)
+	}
+	if sawPrior == nil {
+		t.Fatal("Confirm was not given the prior entry")
+	}
+	if entry, _ := k.Lookup("example.org:1965"); entry.Fingerprint != fingerprint(second) {
+		t.Fatal("confirmed mismatch was not trusted")
+	}
+}
+
+func TestKnownHostsVerifyExpiredRenewal(t *testing.T) {
+	k, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := mustSelfSigned(t, time.Now().Add(-time.Minute))
+	if err := k.Verify("example.org:1965", expired); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	renewed := mustSelfSigned(t, time.Now().Add(time.Hour))
+	if err := k.Verify("example.org:1965", renewed); err != nil {
+		t.Fatalf("renewal after expiry: %v", err)
+	}
+	if entry, _ := k.Lookup("example.org:1965"); entry.Fingerprint != fingerprint(renewed) {
+		t.Fatal("renewed certificate was not trusted")
+	}
+}
+
+func TestKnownHostsVerifyConfirmDenies(t *testing.T) {
+	k, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Confirm = func(host string, cert *x509.Certificate, prior *HostEntry) bool { return false }
+
+	cert := mustSelfSigned(t, time.Now().Add(time.Hour))
+	if err := k.Verify("example.org:1965", cert); err == nil {
+		t.Fatal("expected first use to be denied")
+	}
+	if _, found := k.Lookup("example.org:1965"); found {
+		t.Fatal("denied certificate was trusted anyway")
+	}
+}
+
+func TestKnownHostsSaveMergesConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+
+	a, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certA := mustSelfSigned(t, time.Now().Add(time.Hour))
+	certB := mustSelfSigned(t, time.Now().Add(time.Hour))
+
+	if err := a.Trust("a.example:1965", certA); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Trust("b.example:1965", certB); err != nil {
+		t.Fatal(err)
+	}
+
+	merged, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := merged.Lookup("a.example:1965"); !found {
+		t.Fatal("a.example's entry was lost")
+	}
+	if _, found := merged.Lookup("b.example:1965"); !found {
+		t.Fatal("b.example's entry was lost")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import "strings"
+
+// ServeMux is a Gemini request multiplexer, modeled after net/http.ServeMux.
+// Patterns are paths, optionally preceded by a host ("example.org/docs/");
+// a pattern without a host matches any host. A pattern ending in a slash
+// matches any path under it, any other pattern only that exact path. The
+// longest matching pattern wins.
+type ServeMux struct {
+	entries         []muxEntry
+	needsClientCert bool
+}
+
+type muxEntry struct {
+	pattern string
+	host    string
+	path    string
+	handler Handler
+}
+
+// NewServeMux allocates and returns a new ServeMux.
+func NewServeMux() *ServeMux {
+	return new(ServeMux)
+}
+
+// Handle registers handler for the given pattern.
+func (mux *ServeMux) Handle(pattern string, handler Handler) {
+	if pattern == "" {
+		panic("gemini: invalid pattern")
+	}
+	if handler == nil {
+		panic("gemini: nil handler")
+	}
+
+	host, path := splitPattern(pattern)
+	mux.entries = append(mux.entries, muxEntry{pattern, host, path, handler})
+
+	if rc, ok := handler.(interface{ RequiresClientCert() bool }); ok && rc.RequiresClientCert() {
+		mux.needsClientCert = true
+	}
+}
+
+// RequiresClientCert reports whether any handler registered with mux
+// requires a client certificate. Server.Serve consults it via a type
+// assertion to decide whether to request one during the TLS handshake.
+func (mux *ServeMux) RequiresClientCert() bool {
+	return mux.needsClientCert
+}
+
+// HandleFunc registers f, adapted via HandlerFunc, for the given pattern.
+func (mux *ServeMux) HandleFunc(pattern string, f func(*ResponseWriter, *Request)) {
+	mux.Handle(pattern, HandlerFunc(f))
+}
+
+func splitPattern(pattern string) (host, path string) {
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		return pattern[:i], pattern[i:]
+	}
+	return "", pattern
+}
+
+// pathMatches reports whether path is matched by pattern, the way
+// net/http.ServeMux matches a registered path-only pattern: a
+// slash-terminated pattern matches any path under it, while any other
+// pattern must match the path exactly.
+func pathMatches(pattern, path string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(path, pattern)
+	}
+	return path == pattern
+}
+
+// Handler returns the handler registered for the request's host and path,
+// along with the pattern that matched. If no pattern matches, it returns
+// (NotFoundHandler(), "").
+func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	host := r.URL.Hostname()
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	var best *muxEntry
+	for i := range mux.entries {
+		e := &mux.entries[i]
+		if e.host != "" && e.host != host {
+			continue
+		}
+		if !pathMatches(e.path, path) {
+			continue
+		}
+		if best == nil || len(e.pattern) > len(best.pattern) {
+			best = e
+		}
+	}
+
+	if best == nil {
+		return NotFoundHandler(), ""
+	}
+	return best.handler, best.pattern
+}
+
+// ServeGemini dispatches the request to the handler whose pattern most
+// closely matches the request's host and path.
+func (mux *ServeMux) ServeGemini(w *ResponseWriter, r *Request) {
+	h, _ := mux.Handler(r)
+	h.ServeGemini(w, r)
+}
+
+// NotFoundHandler returns a Handler that always replies with StatusNotFound.
+func NotFoundHandler() Handler {
+	return HandlerFunc(func(w *ResponseWriter, r *Request) {
+		w.WriteHeader(NotFound())
+	})
+}
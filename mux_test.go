@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"net/url"
+	"testing"
+)
+
+// namedHandler lets a test tell which registered handler matched, without
+// relying on comparing func values.
+type namedHandler string
+
+func (h namedHandler) ServeGemini(w *ResponseWriter, r *Request) {}
+
+func TestServeMuxHandler(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/docs/", namedHandler("docs"))
+	mux.Handle("/docs/index.gmi", namedHandler("docs-index"))
+	mux.Handle("/", namedHandler("root"))
+	mux.Handle("example.org/", namedHandler("example.org"))
+
+	tests := []struct {
+		host, path string
+		want       namedHandler
+	}{
+		{"", "/docs/", "docs"},
+		{"", "/docs/foo", "docs"},
+		{"", "/docs/index.gmi", "docs-index"},
+		// "/docs" doesn't fall under the "/docs/" prefix, and isn't an
+		// exact match for any pattern, so it must not match "/docs/".
+		{"", "/docs", "root"},
+		{"", "/other", "root"},
+		{"", "/", "root"},
+		{"example.org", "/", "example.org"},
+		{"other.org", "/", "root"},
+	}
+
+	for _, test := range tests {
+		r := &Request{URL: mustParseURL(t, "gemini://"+test.host+test.path)}
+		h, _ := mux.Handler(r)
+		got, ok := h.(namedHandler)
+		if !ok || got != test.want {
+			t.Errorf("Handler(host=%q, path=%q) = %v, want %v", test.host, test.path, h, test.want)
+		}
+	}
+}
+
+func TestServeMuxNoMatch(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("/docs/", namedHandler("docs"))
+
+	r := &Request{URL: mustParseURL(t, "gemini://example.org/other")}
+	h, pattern := mux.Handler(r)
+	if pattern != "" {
+		t.Errorf("pattern = %q, want empty", pattern)
+	}
+	if _, ok := h.(namedHandler); ok {
+		t.Error("Handler matched a registered entry, want NotFoundHandler")
+	}
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatalf("url.Parse(%q): %v", s, err)
+	}
+	return u
+}
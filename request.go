@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+)
+
+// Request describes an incoming Gemini request passed to a Handler.
+type Request struct {
+	URL *url.URL
+
+	// RemoteAddr is the client's network address.
+	RemoteAddr net.Addr
+
+	// TLS is the connection's TLS state, including the certificate chain
+	// the client presented, if any. With tls.RequestClientCert, as set by
+	// RequireClientCert, that chain is not verified.
+	TLS tls.ConnectionState
+
+	// ServerName is the hostname the client sent via SNI during the TLS
+	// handshake. It may differ from URL.Host behind a HostMux.
+	ServerName string
+
+	ctx context.Context
+}
+
+// Context returns the request's context. It is always non-nil, and is
+// canceled when the underlying connection is closed.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r with its context replaced by ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := new(Request)
+	*r2 = *r
+	r2.ctx = ctx
+	return r2
+}
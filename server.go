@@ -6,14 +6,35 @@ package gemini
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"log"
 	"net"
 	"net/url"
-	"strings"
 	"time"
 )
 
+const (
+	// DefaultReadTimeout bounds how long Handshake/Server.Serve wait for
+	// a client to send its request line, matching the twins Gemini
+	// server.
+	DefaultReadTimeout = 30 * time.Second
+
+	// DefaultMaxURLBytes is the Gemini spec's limit on request line
+	// length, excluding the trailing CRLF.
+	DefaultMaxURLBytes = 1024
+)
+
+// errRequestLineTooLong and errMalformedRequestLine are returned by
+// Handshake (and handshake) with a non-nil *ServerConn, so that callers can
+// still reply with a status line before closing the connection.
+var (
+	errRequestLineTooLong   = errors.New("gemini: request line too long")
+	errMalformedRequestLine = errors.New("gemini: request line missing CRLF terminator")
+)
+
 type ServerConn struct {
 	raw net.Conn // nil after closing.
 	tls *tls.Conn
@@ -92,6 +113,14 @@ func (w *ResponseWriter) WriteHeader(h ResponseHeader) {
 	_, w.headErr = w.conn.Write(h.Bytes())
 }
 
+// markSent marks the header as already written, without writing anything
+// itself, for handlers (such as CGIHandler) whose response header is
+// produced by something other than WriteHeader but that still write
+// through to the same connection. Finish then knows not to default one in.
+func (w *ResponseWriter) markSent() {
+	w.headDone = true
+}
+
 func (w *ResponseWriter) Write(b []byte) (int, error) {
 	if !w.headDone {
 		w.WriteHeader(Success("text/gemini"))
@@ -116,55 +145,255 @@ func (w *ResponseWriter) Finish() error {
 
 type HandleFunc func(*ServerConn, *url.URL)
 
+// Listen accepts connections on l, handling each with f in its own
+// goroutine. It is a
+// thin adapter over Server/Handler for callers that don't need routing.
 func Listen(l net.Listener, config *tls.Config, f HandleFunc) error {
-	config = initTLSConfig(config)
+	s := &Server{
+		Handler:   handleFuncHandler{f},
+		TLSConfig: config,
+	}
+	return s.Serve(l)
+}
+
+// handleFuncHandler adapts a HandleFunc to the routing Handler interface
+// for Listen's sake, recovering the *ServerConn that ResponseWriter wraps.
+type handleFuncHandler struct {
+	f HandleFunc
+}
+
+func (h handleFuncHandler) ServeGemini(w *ResponseWriter, r *Request) {
+	h.f(w.conn.(*ServerConn), r.URL)
+}
+
+// Handshake performs the TLS handshake on rawConn and reads the Gemini
+// request line off it, with the default read timeout and request line
+// size limit. Use handshake directly to override them (as Server.Serve
+// does).
+func Handshake(rawConn net.Conn, config *tls.Config) (*ServerConn, *url.URL, error) {
+	return handshake(rawConn, config, 0, 0)
+}
+
+// handshake is like Handshake, but lets the caller override the read
+// timeout and request line size limit; zero means the package default.
+// On a request line violation (too long, or missing the CRLF terminator)
+// it still returns a usable *ServerConn so the caller can reply with a
+// status line before closing, alongside the descriptive error.
+func handshake(rawConn net.Conn, config *tls.Config, readTimeout time.Duration, maxURLBytes int) (*ServerConn, *url.URL, error) {
+	if readTimeout <= 0 {
+		readTimeout = DefaultReadTimeout
+	}
+	if maxURLBytes <= 0 {
+		maxURLBytes = DefaultMaxURLBytes
+	}
+
+	if err := rawConn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return nil, nil, err
+	}
+
+	tlsConn := tls.Server(rawConn, config)
+	r := bufio.NewReader(tlsConn)
+	conn := &ServerConn{raw: rawConn, tls: tlsConn}
+
+	line, err := readRequestLine(r, maxURLBytes)
+	if err != nil {
+		if err == errRequestLineTooLong || err == errMalformedRequestLine {
+			return conn, nil, err
+		}
+		return nil, nil, err
+	}
+
+	if err := rawConn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+
+	u, err := url.Parse(line)
+	if err != nil {
+		return conn, u, err
+	}
+
+	return conn, u, nil
+}
+
+// readRequestLine reads a single CRLF-terminated line, capped at maxBytes
+// bytes excluding the terminator, without relying on bufio.Reader.ReadString
+// (which has no upper bound on how much it buffers before seeing '\n').
+func readRequestLine(r *bufio.Reader, maxBytes int) (string, error) {
+	var buf bytes.Buffer
 
 	for {
-		if err := accept(l, config, f); err != nil {
-			return err
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		buf.WriteByte(b)
+		if b == '\n' {
+			break
+		}
+		if buf.Len() > maxBytes+1 {
+			return "", errRequestLineTooLong
 		}
 	}
+
+	line := buf.Bytes()
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", errMalformedRequestLine
+	}
+
+	return string(line[:len(line)-2]), nil
 }
 
-func accept(l net.Listener, config *tls.Config, f HandleFunc) error {
-	rawConn, err := l.Accept()
+// Server defines parameters for running a Gemini server with routing, as
+// an alternative to the lower-level Listen.
+type Server struct {
+	Handler      Handler
+	TLSConfig    *tls.Config
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// MaxURLBytes caps the size of the request line. Zero means the
+	// Gemini spec's default of 1024 bytes.
+	MaxURLBytes int
+
+	// Hostnames restricts which request URL hosts are served; requests
+	// for any other host get StatusProxyRequestRefused. Empty means
+	// accept any host.
+	Hostnames []string
+
+	ErrorLog *log.Logger
+}
+
+func (s *Server) hostAllowed(host string) bool {
+	if len(s.Hostnames) == 0 {
+		return true
+	}
+	for _, h := range s.Hostnames {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe listens on addr and calls Serve.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l, dispatching each to its own goroutine,
+// which then calls s.Handler.
+func (s *Server) Serve(l net.Listener) error {
+	config := initTLSConfig(s.TLSConfig)
+
+	if rc, ok := s.Handler.(interface{ RequiresClientCert() bool }); ok && rc.RequiresClientCert() {
+		config.ClientAuth = tls.RequestClientCert
+	}
+
+	for {
+		rawConn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(rawConn, config)
+	}
+}
+
+// serve handles a single accepted connection. It runs in its own
+// goroutine, so a slow or malicious client can't stall other connections,
+// and it recovers from a panic in s.Handler so one broken request can't
+// take down the listener.
+func (s *Server) serve(rawConn net.Conn, config *tls.Config) {
+	remoteAddr := rawConn.RemoteAddr()
 	defer func() {
 		if rawConn != nil {
 			rawConn.Close()
 		}
 	}()
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("%v: panic: %v", remoteAddr, r)
+		}
+	}()
 
-	myConn, u, err := Server(rawConn, config)
-	if err != nil {
-		log.Printf("%v: %v", rawConn.RemoteAddr(), err)
-		return nil
+	conn, u, err := handshake(rawConn, config, s.ReadTimeout, s.MaxURLBytes)
+	if conn == nil {
+		s.logf("%v: %v", rawConn.RemoteAddr(), err)
+		return
 	}
-
-	f(myConn, u)
 	rawConn = nil
-	return nil
-}
+	defer conn.Close()
 
-func Server(rawConn net.Conn, config *tls.Config) (*ServerConn, *url.URL, error) {
-	tlsConn := tls.Server(rawConn, config)
-	r := bufio.NewReader(tlsConn)
+	w := NewResponseWriter(conn)
 
-	line, err := r.ReadString('\n')
-	if err != nil {
-		return nil, nil, err
+	switch {
+	case err == errRequestLineTooLong || err == errMalformedRequestLine:
+		s.logf("%v: %v", conn.RemoteAddr(), err)
+		w.WriteHeader(BadRequest())
+		w.Finish()
+		return
+
+	case err != nil:
+		s.logf("%v: %v", conn.RemoteAddr(), err)
+		w.WriteHeader(BadRequest())
+		w.Finish()
+		return
+
+	case u.Scheme != "gemini":
+		w.WriteHeader(ProxyRequestRefused())
+		w.Finish()
+		return
+
+	case !s.hostAllowed(u.Hostname()):
+		w.WriteHeader(ProxyRequestRefused())
+		w.Finish()
+		return
 	}
-	line = line[:len(line)-1]
-	if strings.HasSuffix(line, "\r") {
-		line = line[:len(line)-1]
+
+	if s.WriteTimeout > 0 {
+		conn.SetDeadline(time.Now().Add(s.WriteTimeout))
 	}
 
-	u, err := url.Parse(line)
-	if err != nil {
-		return nil, u, err
+	h := s.Handler
+	if h == nil {
+		h = NotFoundHandler()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchClosed(conn, cancel)
+
+	r := &Request{
+		URL:        u,
+		RemoteAddr: conn.RemoteAddr(),
+		TLS:        conn.ConnectionState(),
+		ServerName: conn.ConnectionState().ServerName,
+		ctx:        ctx,
 	}
 
-	return &ServerConn{raw: rawConn, tls: tlsConn}, u, nil
+	h.ServeGemini(w, r)
+	w.Finish()
+}
+
+// watchClosed cancels cancel once conn's connection produces a read error
+// (typically because the client hung up), so a Request's Context can be
+// used to abandon long-running work, such as a CGI child, when the client
+// goes away. Clients don't send anything after the request line, so this
+// blocks harmlessly until the connection is closed.
+func watchClosed(conn *ServerConn, cancel context.CancelFunc) {
+	defer cancel()
+	var buf [1]byte
+	conn.tls.Read(buf[:])
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
 }